@@ -5,8 +5,26 @@ package ircutil
 import (
 	"fmt"
 	"math/rand"
+	"strings"
+	"unicode/utf8"
 )
 
+// mIRC control codes used to track active text formatting across a split
+// message so it can be re-applied at the start of each continuation line.
+const (
+	ctrlBold      = '\x02'
+	ctrlColor     = '\x03'
+	ctrlItalic    = '\x1D'
+	ctrlUnderline = '\x1F'
+	ctrlReverse   = '\x16'
+	ctrlReset     = '\x0F'
+)
+
+// maxHostLen is the conservative placeholder hostname length (RFC 2812
+// HOSTLEN) used to estimate our own nick!user@host mask before the server
+// has assigned us a real one.
+const maxHostLen = 63
+
 // SendJoin attaches to a channel with an optional password. An empty string
 // indicates no password.
 func SendJoin(client *Client, channel string, pass string) {
@@ -37,9 +55,14 @@ func SendNickservPass(client *Client, pass string) {
 	SendPrivmsg(client, "nickserv", fmt.Sprintf("identify %s", pass))
 }
 
-// SendNotice sends a notice to a user or channel.
+// SendNotice sends a notice to a user or channel, splitting it across
+// multiple lines if it would otherwise exceed the server's line length
+// limit.
 func SendNotice(client *Client, target string, msg string) {
-	sendRawf(client, "NOTICE %s :%s", target, msg)
+	max := maxMessageWidth(client, "NOTICE", target)
+	for _, line := range splitMessageLines(msg, max) {
+		sendRawf(client, "NOTICE %s :%s", target, line)
+	}
 }
 
 // SendPart detaches from a channel with an optional message. An empty string
@@ -66,9 +89,23 @@ func SendPong(client *Client, msg string) {
 	sendRawf(client, "PONG :%s", msg)
 }
 
-// SendPrivmsg sends a message to a user or channel.
+// SendPrivmsg sends a message to a user or channel, splitting it across
+// multiple lines if it would otherwise exceed the server's line length
+// limit.
 func SendPrivmsg(client *Client, target string, msg string) {
-	sendRawf(client, "PRIVMSG %s :%s", target, msg)
+	SendPrivmsgLines(client, target, msg)
+}
+
+// SendPrivmsgLines sends msg to target as one or more PRIVMSGs, splitting it
+// on byte-safe UTF-8 boundaries (preferring a preceding word break) when it
+// would otherwise exceed the server's line length limit, and re-emitting any
+// active mIRC formatting codes at the start of each continuation. Messages
+// that already fit are sent unsplit.
+func SendPrivmsgLines(client *Client, target string, msg string) {
+	max := maxMessageWidth(client, "PRIVMSG", target)
+	for _, line := range splitMessageLines(msg, max) {
+		sendRawf(client, "PRIVMSG %s :%s", target, line)
+	}
 }
 
 // SendResponse determines whether a message should be sent to a user or
@@ -100,3 +137,172 @@ func sendRaw(client *Client, msg string) {
 func sendRawf(client *Client, format string, a ...interface{}) {
 	sendRaw(client, fmt.Sprintf(format, a...))
 }
+
+// maxMessageWidth computes the maximum byte length of a PRIVMSG/NOTICE
+// trailing parameter the server will accept for target, using the
+// server-advertised LINELEN if available, or else 512 bytes minus our own
+// nick!user@host prefix (assuming a conservative, maximum-length host when
+// the server has not yet assigned us a real one).
+func maxMessageWidth(client *Client, command string, target string) int {
+	overhead := len(fmt.Sprintf(":%s %s %s :\r\n", identityMask(client), command,
+		target))
+
+	limit := 512
+	if n, ok := client.ServerOptionInt("LINELEN"); ok && n > 0 {
+		limit = n
+	}
+
+	if budget := limit - overhead; budget > 0 {
+		return budget
+	}
+	return 1
+}
+
+// identityMask returns the client's best-known nick!user@host mask, using a
+// conservative maximum-length placeholder host since the real one is
+// assigned by the server and not known to the client.
+func identityMask(client *Client) string {
+	user := "user"
+	if client.User != nil && len(client.User.User) > 0 {
+		user = client.User.User
+	}
+	return fmt.Sprintf("%s!%s@%s", client.Nick, user, strings.Repeat("x", maxHostLen))
+}
+
+// formatState tracks the mIRC formatting codes active at a point in a
+// message, so they can be re-emitted at the start of a continuation line
+// produced by splitMessageLines.
+type formatState struct {
+	bold, italic, underline, reverse bool
+	color                            string
+}
+
+// apply updates the format state for control code r, consuming any color
+// digits immediately following it in rest, and returns how many bytes of
+// rest were consumed.
+func (f *formatState) apply(r rune, rest string) int {
+	switch r {
+	case ctrlBold:
+		f.bold = !f.bold
+	case ctrlItalic:
+		f.italic = !f.italic
+	case ctrlUnderline:
+		f.underline = !f.underline
+	case ctrlReverse:
+		f.reverse = !f.reverse
+	case ctrlReset:
+		*f = formatState{}
+	case ctrlColor:
+		color, consumed := parseColorDigits(rest)
+		f.color = color
+		return consumed
+	}
+	return 0
+}
+
+// prefix renders the currently active formatting codes so they can be
+// re-emitted at the start of a continuation line.
+func (f *formatState) prefix() string {
+	var b strings.Builder
+	if f.bold {
+		b.WriteRune(ctrlBold)
+	}
+	if f.italic {
+		b.WriteRune(ctrlItalic)
+	}
+	if f.underline {
+		b.WriteRune(ctrlUnderline)
+	}
+	if f.reverse {
+		b.WriteRune(ctrlReverse)
+	}
+	if len(f.color) > 0 {
+		b.WriteRune(ctrlColor)
+		b.WriteString(f.color)
+	}
+	return b.String()
+}
+
+// parseColorDigits reads an mIRC color code's optional "fg[,bg]" digit
+// sequence (1-2 digits per component) from the start of s, returning the
+// digits found and how many bytes were consumed.
+func parseColorDigits(s string) (string, int) {
+	end := 0
+	for end < len(s) && end < 2 && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	if end < 1 {
+		return "", 0
+	}
+
+	total := end
+	if total < len(s) && s[total] == ',' {
+		bgEnd := total + 1
+		for bgEnd < len(s) && bgEnd-(total+1) < 2 && s[bgEnd] >= '0' && s[bgEnd] <= '9' {
+			bgEnd++
+		}
+		if bgEnd > total+1 {
+			return s[:bgEnd], bgEnd
+		}
+	}
+	return s[:total], total
+}
+
+// splitMessageLines splits msg into chunks of at most maxBytes bytes each,
+// cutting only on byte-safe UTF-8 rune boundaries and preferring to cut at a
+// preceding ASCII space so words and multi-byte runes are not sliced. Active
+// mIRC formatting codes are tracked and re-emitted at the start of each
+// continuation. A message that already fits is returned unsplit.
+func splitMessageLines(msg string, maxBytes int) []string {
+	if maxBytes < 1 {
+		maxBytes = 1
+	}
+	if len(msg) <= maxBytes {
+		return []string{msg}
+	}
+
+	var lines []string
+	state := &formatState{}
+	prefix := ""
+	remaining := msg
+
+	for len(remaining) > 0 {
+		budget := maxBytes - len(prefix)
+		if budget < 1 {
+			budget = 1
+		}
+
+		if len(remaining) <= budget {
+			lines = append(lines, prefix+remaining)
+			break
+		}
+
+		cut := budget
+		for cut > 0 && !utf8.RuneStart(remaining[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			// budget is too small to fit even the first rune without slicing
+			// it in half; take the whole rune instead of making no progress.
+			_, size := utf8.DecodeRuneInString(remaining)
+			cut = size
+		}
+		if space := strings.LastIndexByte(remaining[:cut], ' '); space > 0 {
+			cut = space
+		}
+
+		chunk := remaining[:cut]
+		lines = append(lines, prefix+chunk)
+
+		for i := 0; i < len(chunk); {
+			r, size := utf8.DecodeRuneInString(chunk[i:])
+			consumed := state.apply(r, chunk[i+size:])
+			i += size + consumed
+		}
+
+		remaining = strings.TrimPrefix(remaining[cut:], " ")
+		prefix = state.prefix()
+	}
+
+	return lines
+}
@@ -0,0 +1,196 @@
+package ircutil
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SASL mechanism identifiers supported by ircutil.
+const (
+	SASLPlain    = "PLAIN"
+	SASLExternal = "EXTERNAL"
+	SASLScram256 = "SCRAM-SHA-256"
+)
+
+// saslChunkSize is the maximum number of base64-encoded bytes sent per
+// AUTHENTICATE line, as specified by the IRCv3 SASL specification. A final
+// chunk that exactly fills this size must be followed by an empty
+// "AUTHENTICATE +" to signal the end of the payload.
+const saslChunkSize = 400
+
+// negotiationTimeout bounds how long negotiateCapabilities waits for the
+// server to complete CAP negotiation, in case it never acknowledges or
+// rejects the request (e.g. an old ircd that silently ignores "CAP LS").
+const negotiationTimeout = 30 * time.Second
+
+// negotiateCapabilities requests IRCv3 capabilities advertised by the server
+// and, if SASL credentials are configured, authenticates before registration
+// completes. It blocks until negotiation finishes, the connection drops, or
+// negotiationTimeout elapses, and must be called after the connection is
+// established but before NICK/USER are sent.
+func negotiateCapabilities(client *Client) error {
+	client.capAvailable = make(map[string]bool)
+	client.capDone = make(chan error, 1)
+	client.EnabledCaps = nil
+
+	sendRaw(client, "CAP LS 302")
+
+	select {
+	case err := <-client.capDone:
+		return err
+	case <-client.Done:
+		return errors.New("negotiating capabilities: connection closed")
+	case <-time.After(negotiationTimeout):
+		return errors.New("negotiating capabilities: timed out")
+	}
+}
+
+// handleCap processes a CAP message from the server, continuing negotiation
+// through LS, REQ/ACK/NAK, and SASL authentication.
+func handleCap(client *Client, msg *Message) {
+	if len(msg.Params) < 2 {
+		return
+	}
+	switch msg.Params[1] {
+	case "LS":
+		handleCapLs(client, msg.Params[2:])
+	case "ACK":
+		handleCapAck(client, msg.Params[2:])
+	case "NAK":
+		endCapNegotiation(client, fmt.Errorf(
+			"negotiating capabilities: server rejected requested capabilities"))
+	}
+}
+
+// handleCapLs records capabilities advertised by the server, accounting for
+// multiline "CAP * LS" continuations, then requests the desired subset once
+// the final line is received.
+func handleCapLs(client *Client, params []string) {
+	more := len(params) > 0 && params[0] == "*"
+	if more {
+		params = params[1:]
+	}
+	if len(params) < 1 {
+		return
+	}
+
+	for _, token := range strings.Fields(params[0]) {
+		name := strings.SplitN(token, "=", 2)[0]
+		client.capAvailable[name] = true
+	}
+	if more {
+		return
+	}
+
+	var req []string
+	for _, c := range client.Caps {
+		if client.capAvailable[c] {
+			req = append(req, c)
+		}
+	}
+	if len(client.Authentication.SASLMechanism) > 0 && client.capAvailable["sasl"] {
+		req = append(req, "sasl")
+	}
+
+	if len(req) < 1 {
+		endCapNegotiation(client, nil)
+		return
+	}
+	sendRawf(client, "CAP REQ :%s", strings.Join(req, " "))
+}
+
+// handleCapAck begins SASL authentication if "sasl" was acknowledged,
+// otherwise negotiation is complete.
+func handleCapAck(client *Client, params []string) {
+	if len(params) < 1 {
+		return
+	}
+	acked := strings.Fields(params[0])
+	client.EnabledCaps = append(client.EnabledCaps, acked...)
+
+	for _, c := range acked {
+		if c == "sasl" {
+			sendRawf(client, "AUTHENTICATE %s", client.Authentication.SASLMechanism)
+			return
+		}
+	}
+	endCapNegotiation(client, nil)
+}
+
+// endCapNegotiation sends CAP END and unblocks negotiateCapabilities with
+// the given error, which is nil on success.
+func endCapNegotiation(client *Client, err error) {
+	sendRaw(client, "CAP END")
+	if client.capDone != nil {
+		client.capDone <- err
+		client.capDone = nil
+	}
+}
+
+// handleAuthenticate processes an AUTHENTICATE challenge from the server
+// during SASL authentication, reassembling payloads split across multiple
+// 400-byte chunks before acting on them.
+func handleAuthenticate(client *Client, msg *Message) {
+	if len(msg.Params) < 1 {
+		return
+	}
+	chunk := msg.Params[0]
+	if chunk != "+" {
+		client.saslBuf += chunk
+		if len(chunk) == saslChunkSize {
+			return
+		}
+	}
+	data := client.saslBuf
+	client.saslBuf = ""
+
+	switch client.Authentication.SASLMechanism {
+	case SASLExternal:
+		sendSASLPayload(client, nil)
+	case SASLPlain:
+		payload := fmt.Sprintf("\x00%s\x00%s", client.Authentication.SASLUser,
+			client.Authentication.SASLPass)
+		sendSASLPayload(client, []byte(payload))
+	case SASLScram256:
+		handleSCRAMChallenge(client, data)
+	default:
+		failSASL(client, fmt.Errorf(
+			"authenticating: unsupported SASL mechanism %s",
+			client.Authentication.SASLMechanism))
+	}
+}
+
+// failSASL aborts SASL authentication, unblocking negotiateCapabilities with
+// the given error after ending capability negotiation.
+func failSASL(client *Client, err error) {
+	sendRaw(client, "AUTHENTICATE *")
+	endCapNegotiation(client, err)
+}
+
+// sendSASLPayload base64-encodes a SASL payload and sends it to the server
+// in chunks of at most saslChunkSize bytes, per the IRCv3 SASL
+// specification. An empty payload is sent as a single "AUTHENTICATE +".
+func sendSASLPayload(client *Client, payload []byte) {
+	if len(payload) < 1 {
+		sendRaw(client, "AUTHENTICATE +")
+		return
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(payload)
+	for len(encoded) > 0 {
+		n := saslChunkSize
+		if n > len(encoded) {
+			n = len(encoded)
+		}
+		chunk := encoded[:n]
+		encoded = encoded[n:]
+		sendRawf(client, "AUTHENTICATE %s", chunk)
+		if len(chunk) < saslChunkSize {
+			return
+		}
+	}
+	sendRaw(client, "AUTHENTICATE +")
+}
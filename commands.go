@@ -2,8 +2,9 @@ package ircutil
 
 import "errors"
 
-// Message stores information about the message the triggered the command.
-type Message struct {
+// CmdMessage stores information about the message that triggered the
+// command.
+type CmdMessage struct {
 	Source  string
 	Target  string
 	Trigger string
@@ -16,7 +17,7 @@ type CmdMap map[string]CmdFunc
 
 // CmdFunc is a function that's executed for a command, providing necessary
 // details to perform an action.
-type CmdFunc func(*Client, *Command, *Message)
+type CmdFunc func(*Client, *Command, *CmdMessage)
 
 // InitCommands returns an empty map that can store pointers to functions which
 // may be called using strings from config.
@@ -32,7 +33,7 @@ func AddCommand(cmdMap CmdMap, key string, cmdFunc CmdFunc) {
 // ExecCommand executes a command given a string key, or returns an error if
 // the key is not a valid command.
 func ExecCommand(client *Client, key string, command *Command,
-	message *Message) error {
+	message *CmdMessage) error {
 	if cmdFunc, exists := client.CmdMap[key]; exists {
 		go cmdFunc(client, command, message)
 	} else {
@@ -4,12 +4,11 @@ package ircutil
 
 import (
 	"bufio"
-	"crypto/tls"
 	"errors"
-	"fmt"
 	"net"
 	"regexp"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -75,19 +74,39 @@ type Client struct {
 	// (Optional) List of client admin nicknames able to run commands set to
 	// admin-only. Default: []
 	Admins []string `json:"admins"`
+	// (Optional) List of IRCv3 capabilities to request from the server
+	// during connection, if advertised (e.g., "server-time",
+	// "message-tags"). Default: []
+	Caps []string `json:"caps"`
 	// (Optional) Authentication credentials to used in connection.
 	// Defaults: All nested defaults
 	Authentication `json:"authentication"`
+	// (Optional) Automatic reconnection behavior for Run. Defaults: All
+	// nested defaults
+	Reconnect `json:"reconnect"`
 	// Other non-configurable values.
 	CmdMap
-	Commands []Command
-	Debug    bool
-	Ready    func(*Client)
-	Done     chan bool
-	Server   *Server
-	User     *User
-	Conn     net.Conn
-	Nick     string
+	Commands    []Command
+	Debug       bool
+	Ready       func(*Client)
+	Done        chan bool
+	Server      *Server
+	User        *User
+	Conn        net.Conn
+	Nick        string
+	EnabledCaps []string
+	Transport   Transport
+
+	capAvailable map[string]bool
+	capDone      chan error
+	saslBuf      string
+	scram        *scramState
+
+	handlers           map[string][]*handlerEntry
+	handlersMu         sync.Mutex
+	handlerSeq         int
+	defaultsRegistered bool
+	state              *State
 }
 
 // Authentication stores authentication credentials for servers and nicknames.
@@ -98,6 +117,19 @@ type Authentication struct {
 	// (Optional) Nickserv password to identify user with nickserv. Empty
 	// string for none. Default: ""
 	Nickserv string `json:"nickserv"`
+	// (Optional) SASL mechanism to authenticate with. One of SASLPlain,
+	// SASLExternal, or SASLScram256. Empty string for none. Default: ""
+	SASLMechanism string `json:"saslMechanism"`
+	// (Optional) SASL account name, used with SASLPlain and SASLScram256.
+	// Default: ""
+	SASLUser string `json:"saslUser"`
+	// (Optional) SASL account password, used with SASLPlain and
+	// SASLScram256. Default: ""
+	SASLPass string `json:"saslPass"`
+	// (Optional) Paths to a PEM-encoded client certificate and key presented
+	// during the TLS handshake, used with SASLExternal. Default: ""
+	SASLCertFile string `json:"saslCertFile"`
+	SASLKeyFile  string `json:"saslKeyFile"`
 }
 
 // Command stores command triggers, execution details, and settings, with the
@@ -122,6 +154,8 @@ type Command struct {
 // using the specified user information. It sends initial messages as required
 // by the IRC protocol.
 func EstablishConnection(client *Client) error {
+	registerDefaults(client)
+
 	// Error if server or user id is empty or non-alphanumeric.
 	r, _ := regexp.Compile("^[0-9A-Za-z]+$")
 	matched := r.MatchString(client.ServerID)
@@ -148,22 +182,16 @@ func EstablishConnection(client *Client) error {
 		return errors.New("establishing connection: nickname too short")
 	}
 
-	// Attempt connection establishment. Use TLS if secure is specified. Timeout
-	// after one minute.
-	var conn net.Conn
-	var err error
-	if client.Server.Secure {
-		conn, err = tls.DialWithDialer(&(net.Dialer{Timeout: time.Minute}), "tcp",
-			fmt.Sprintf("%s:%d", client.Server.Host, client.Server.Port), nil)
-	} else {
-		conn, err = net.DialTimeout("tcp", fmt.Sprintf("%s:%d",
-			client.Server.Host, client.Server.Port), time.Minute)
-	}
+	// Attempt connection establishment via the client's Transport (raw TCP/TLS
+	// by default), loading a client certificate if one was configured for SASL
+	// EXTERNAL. Timeout after one minute.
+	conn, err := dial(client)
 	if err != nil {
 		return err
 	}
 	Logf(client, "Connected to server %s:%d (%s)", client.Server.Host,
 		client.Server.Port, conn.RemoteAddr())
+	dispatch(client, "CONNECTED", nil)
 
 	// Update connection in client and start reading from server and pinging
 	// periodically.
@@ -171,6 +199,14 @@ func EstablishConnection(client *Client) error {
 	go readLoop(client)
 	go pingLoop(client)
 
+	// Negotiate IRCv3 capabilities and perform SASL authentication, if
+	// configured, before registration completes.
+	if len(client.Caps) > 0 || len(client.Authentication.SASLMechanism) > 0 {
+		if err := negotiateCapabilities(client); err != nil {
+			return err
+		}
+	}
+
 	// Send required user registration messages to server, including password if
 	// specified.
 	if len(client.Authentication.ServerPassword) > 0 {
@@ -202,6 +238,7 @@ func readLoop(client *Client) {
 			client.Conn.SetReadDeadline(time.Time{})
 			if err != nil {
 				Log(client, err.Error())
+				dispatch(client, "DISCONNECTED", nil)
 				close(client.Done)
 			} else {
 				parseMessage(client, msg)
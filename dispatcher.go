@@ -0,0 +1,150 @@
+package ircutil
+
+import "strconv"
+
+// Handler processes a Message dispatched for a registered event. Synthetic
+// events ("CONNECTED", "DISCONNECTED", "REGISTER") pass a nil Message.
+type Handler interface {
+	Handle(client *Client, msg *Message)
+}
+
+// HandlerFunc adapts a plain function to the Handler interface.
+type HandlerFunc func(client *Client, msg *Message)
+
+// Handle calls f(client, msg).
+func (f HandlerFunc) Handle(client *Client, msg *Message) {
+	f(client, msg)
+}
+
+// Remover removes a previously registered handler from its event.
+type Remover interface {
+	Remove()
+}
+
+// removerFunc adapts a plain function to the Remover interface.
+type removerFunc func()
+
+// Remove calls f().
+func (f removerFunc) Remove() {
+	f()
+}
+
+// handlerEntry associates a registered Handler with an id used to remove it.
+type handlerEntry struct {
+	id int
+	h  Handler
+}
+
+// HandleFunc registers fn to run whenever event is dispatched. event is
+// either an IRC command name ("PRIVMSG", "JOIN"), a numeric response code as
+// a string ("433"), or a synthetic event ("CONNECTED", "DISCONNECTED",
+// "REGISTER"). Numeric event strings are normalized by stripping leading
+// zeros, so "004" and "4" register the same handler. The returned Remover
+// unregisters fn.
+func (client *Client) HandleFunc(event string, fn func(*Client, *Message)) Remover {
+	return client.Handle(event, HandlerFunc(fn))
+}
+
+// Handle registers h to run whenever event is dispatched. The returned
+// Remover unregisters h.
+func (client *Client) Handle(event string, h Handler) Remover {
+	event = normalizeEvent(event)
+
+	client.handlersMu.Lock()
+	defer client.handlersMu.Unlock()
+
+	if client.handlers == nil {
+		client.handlers = make(map[string][]*handlerEntry)
+	}
+	client.handlerSeq++
+	id := client.handlerSeq
+	client.handlers[event] = append(client.handlers[event], &handlerEntry{id, h})
+
+	return removerFunc(func() {
+		client.handlersMu.Lock()
+		defer client.handlersMu.Unlock()
+		list := client.handlers[event]
+		for i, entry := range list {
+			if entry.id == id {
+				client.handlers[event] = append(list[:i], list[i+1:]...)
+				return
+			}
+		}
+	})
+}
+
+// dispatch runs every handler registered for event in its own goroutine,
+// passing msg (which is nil for synthetic events). Panics within a handler
+// are recovered and logged rather than crashing the client.
+func dispatch(client *Client, event string, msg *Message) {
+	client.handlersMu.Lock()
+	list := append([]*handlerEntry(nil), client.handlers[event]...)
+	client.handlersMu.Unlock()
+
+	for _, entry := range list {
+		h := entry.h
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					Logf(client, "handler for %s panicked: %v", event, r)
+				}
+			}()
+			h.Handle(client, msg)
+		}()
+	}
+}
+
+// normalizeEvent canonicalizes a numeric response code's string form (e.g.
+// "004", "433") to match how handleResponse dispatches it via
+// strconv.Itoa, so registering on a code's conventional zero-padded form
+// reaches the same handlers as the normalized one. Non-numeric event names
+// (command names, synthetic events) are returned unchanged.
+func normalizeEvent(event string) string {
+	if code, err := strconv.Atoi(event); err == nil {
+		return strconv.Itoa(code)
+	}
+	return event
+}
+
+// registerDefaults installs the client's default protocol handlers: nick
+// randomization on collision, PING/PONG keepalive, Ready on registration,
+// and nick state tracking. Applications may remove or supplement any of
+// them via Handle/HandleFunc.
+func registerDefaults(client *Client) {
+	if client.defaultsRegistered {
+		return
+	}
+	client.defaultsRegistered = true
+	registerStateHandlers(client)
+
+	// 433 ERR_NICKNAMEINUSE is sent when the client tries to change its nick
+	// to one another user is using, forcing us to choose a random one.
+	client.HandleFunc("433", func(c *Client, m *Message) {
+		SendNickRandom(c)
+	})
+
+	// PING is sent by servers upon connection and at regular intervals. We
+	// send the same string back.
+	client.HandleFunc("PING", func(c *Client, m *Message) {
+		if len(m.Params) > 0 {
+			SendPong(c, m.Params[0])
+		}
+	})
+
+	// 004 RPL_MYINFO is the last mandatory message sent after a client
+	// registers with a server, meaning we can now start performing actions.
+	client.HandleFunc("4", func(c *Client, m *Message) {
+		if c.Ready != nil {
+			c.Ready(c)
+		}
+		dispatch(c, "REGISTER", m)
+	})
+
+	// NICK is sent when a nickname is updated. Update the client's own
+	// nickname if it belongs to the client.
+	client.HandleFunc("NICK", func(c *Client, m *Message) {
+		if c.Nick == m.Prefix.Nick && len(m.Params) > 0 {
+			c.Nick = m.Params[0]
+		}
+	})
+}
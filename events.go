@@ -8,70 +8,75 @@ import (
 	"strings"
 )
 
-// parseMessage extracts the sender from a raw IRC message and determines if
-// the message is sending a command or response code. It also extracts the
-// response code if applicable.
-func parseMessage(client *Client, msg string) {
+// parseMessage parses a raw IRC protocol line into a Message and dispatches
+// it to handleResponse if it carries a numeric response code, or
+// handleCommand otherwise.
+func parseMessage(client *Client, line string) {
 	// Remove line ending and print message to console for debugging.
-	msg = strings.TrimSpace(strings.TrimSuffix(msg, "\r\n"))
+	line = strings.TrimSpace(strings.TrimSuffix(line, "\r\n"))
 	if client.Debug {
-		Logf(client, "<= %s", msg)
+		Logf(client, "<= %s", line)
 	}
 
-	// Set empty source and split message into tokens. Update source and remove
-	// it from tokens if found.
-	src, tokens := "", strings.Split(msg, " ")
-	if tokens[0][0] == ':' {
-		src, tokens = tokens[0][1:], tokens[1:]
+	msg, err := ParseMessage(line)
+	if err != nil {
+		Log(client, err.Error())
+		return
 	}
 
-	// Attempt to parse first token as number. If successful, handle the message
-	// as a response. If not, handle the message as a command.
-	if code, err := strconv.Atoi(tokens[0]); err == nil {
-		handleResponse(client, src, code, tokens[1:])
+	if code, err := strconv.Atoi(msg.Command); err == nil {
+		handleResponse(client, msg, code)
 	} else {
-		handleCommand(client, src, tokens[0], tokens[1:])
+		handleCommand(client, msg)
 	}
 }
 
-// handleResponse takes a response code to determine the correct action to take
-// after receiving a message from a server.
-func handleResponse(client *Client, src string, code int, tokens []string) {
+// handleResponse takes a response code to determine the correct action to
+// take after receiving a message from a server, then dispatches it to any
+// handlers registered for the numeric.
+func handleResponse(client *Client, msg *Message, code int) {
 	switch code {
-	// 004 RPL_MYINFO is the last mandatory message to be sent after a client
-	// registers with a server, meaning we can now start performing actions.
-	case 4:
-		client.Ready(client)
-	// 433 ERR_NICKNAMEINUSE is send when the client tries to change its nick
-	// to one another user using, forcing us to choose a random one.
-	case 433:
-		SendNickRandom(client)
+	// 903 RPL_SASLSUCCESS confirms SASL authentication succeeded.
+	case 903:
+		endCapNegotiation(client, nil)
+	// 904-907 are the ERR_SASL* codes sent when authentication fails, is too
+	// long, is aborted, or was already completed.
+	case 904, 905, 906, 907:
+		endCapNegotiation(client, fmt.Errorf("authenticating: SASL failed (%d)", code))
 	}
+	dispatch(client, strconv.Itoa(code), msg)
 }
 
-// handleCommand takes a command to determine the correct action to take after
-// receiving a message from a server.
-func handleCommand(client *Client, src string, cmd string, tokens []string) {
-	switch cmd {
-	// NICK is sent when a nickname is updated. Update client's state if it
-	// belongs to the client.
-	case "NICK":
-		if client.Nick == getNick(src) {
-			client.Nick = strings.Join(tokens, " ")[1:]
-		}
-	// PING is sent by servers upon connection and at regular intervals. We will
-	// send the same string back.
-	case "PING":
-		SendPong(client, strings.Join(tokens, " ")[1:])
+// handleCommand takes a command to determine the correct action to take
+// after receiving a message from a server, then dispatches it to any
+// handlers registered for the command.
+func handleCommand(client *Client, msg *Message) {
+	switch msg.Command {
 	case "PRIVMSG":
-		handleMessage(client, src, tokens[0], tokens[1][1:], tokens[2:])
+		if len(msg.Params) > 1 {
+			handleMessage(client, msg)
+		}
+	// CAP is sent during IRCv3 capability negotiation.
+	case "CAP":
+		handleCap(client, msg)
+	// AUTHENTICATE carries SASL challenges during authentication.
+	case "AUTHENTICATE":
+		handleAuthenticate(client, msg)
 	}
+	dispatch(client, msg.Command, msg)
 }
 
 // handleMessage checks a message for a valid command, end executes the command
 // if found.
-func handleMessage(client *Client, src string, target string, cmd string,
-	tokens []string) {
+func handleMessage(client *Client, msg *Message) {
+	target := msg.Params[0]
+	fields := strings.Fields(msg.Params[1])
+	if len(fields) < 1 {
+		return
+	}
+	cmd, tokens := fields[0], fields[1:]
+	src := msg.Prefix.String()
+
 	// Loop through all commands.
 	for i := range client.Commands {
 		c := &client.Commands[i]
@@ -87,7 +92,7 @@ func handleMessage(client *Client, src string, target string, cmd string,
 				if checkArgs(c.Arguments, tokens) {
 					// Execute command that was found, or error if the function key is not
 					// valid.
-					err := ExecCommand(client, c.Function, c, &Message{src, target,
+					err := ExecCommand(client, c.Function, c, &CmdMessage{src, target,
 						trigger, tokens})
 					if err != nil {
 						Log(client, err.Error())
@@ -120,8 +125,8 @@ func validateCommand(client *Client, settings *Settings, trigger string,
 	scopeMatch := false
 	for i := range settings.Scope {
 		s := &settings.Scope[i]
-		if (*s == "channel" && isChannel(target)) || (*s == "direct" &&
-			!isChannel(target)) {
+		if (*s == "channel" && IsChannel(target)) || (*s == "direct" &&
+			!IsChannel(target)) {
 			scopeMatch = true
 		}
 	}
@@ -132,7 +137,7 @@ func validateCommand(client *Client, settings *Settings, trigger string,
 	// Ensure user admin permissions match the command.
 	if settings.Admin {
 		adminMatch := false
-		nick := getNick(src)
+		nick := GetNick(src)
 		for i := range client.Admins {
 			a := &client.Admins[i]
 			if *a == nick {
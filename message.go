@@ -0,0 +1,177 @@
+package ircutil
+
+import (
+	"errors"
+	"strings"
+)
+
+// tagUnescaper reverses the escape sequences defined by the IRCv3.2
+// message-tags specification when decoding a tag value.
+var tagUnescaper = strings.NewReplacer(`\:`, ";", `\s`, " ", `\\`, `\`, `\r`,
+	"\r", `\n`, "\n")
+
+// tagEscaper applies the escape sequences defined by the IRCv3.2
+// message-tags specification when encoding a tag value.
+var tagEscaper = strings.NewReplacer(`\`, `\\`, ";", `\:`, " ", `\s`, "\r",
+	`\r`, "\n", `\n`)
+
+// Prefix identifies the source of a Message, as either a server name (Nick
+// only) or a full nick!user@host client mask.
+type Prefix struct {
+	Nick string
+	User string
+	Host string
+}
+
+// String formats a Prefix back into raw nick!user@host form, omitting the
+// user and host segments when they are empty.
+func (p Prefix) String() string {
+	if len(p.Nick) < 1 {
+		return ""
+	}
+	s := p.Nick
+	if len(p.User) > 0 {
+		s += "!" + p.User
+	}
+	if len(p.Host) > 0 {
+		s += "@" + p.Host
+	}
+	return s
+}
+
+// Message represents a parsed IRC protocol line, including any IRCv3.2
+// message tags, an optional source prefix, the command, and its parameters.
+type Message struct {
+	Tags    map[string]string
+	Prefix  Prefix
+	Command string
+	Params  []string
+}
+
+// ParseMessage parses a raw IRC protocol line into a Message, handling an
+// IRCv3.2 message-tags block, a source prefix, up to 14 middle parameters,
+// and a final trailing parameter that preserves internal spaces and colons.
+func ParseMessage(line string) (*Message, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) < 1 {
+		return nil, errors.New("parsing message: empty line")
+	}
+
+	m := &Message{Tags: make(map[string]string)}
+
+	if line[0] == '@' {
+		end := strings.IndexByte(line, ' ')
+		if end < 0 {
+			return nil, errors.New("parsing message: malformed tags")
+		}
+		parseTags(m, line[1:end])
+		line = strings.TrimLeft(line[end+1:], " ")
+	}
+
+	if len(line) > 0 && line[0] == ':' {
+		end := strings.IndexByte(line, ' ')
+		if end < 0 {
+			return nil, errors.New("parsing message: malformed prefix")
+		}
+		parsePrefix(m, line[1:end])
+		line = strings.TrimLeft(line[end+1:], " ")
+	}
+
+	if len(line) < 1 {
+		return nil, errors.New("parsing message: missing command")
+	}
+	end := strings.IndexByte(line, ' ')
+	if end < 0 {
+		m.Command = line
+		return m, nil
+	}
+	m.Command = line[:end]
+	line = strings.TrimLeft(line[end+1:], " ")
+
+	for len(line) > 0 {
+		if line[0] == ':' || len(m.Params) == 14 {
+			m.Params = append(m.Params, strings.TrimPrefix(line, ":"))
+			break
+		}
+		end := strings.IndexByte(line, ' ')
+		if end < 0 {
+			m.Params = append(m.Params, line)
+			break
+		}
+		m.Params = append(m.Params, line[:end])
+		line = strings.TrimLeft(line[end+1:], " ")
+	}
+
+	return m, nil
+}
+
+// parseTags populates a Message's Tags from a raw, semicolon-separated
+// "key=value" tag block (with the leading "@" already stripped).
+func parseTags(m *Message, raw string) {
+	for _, pair := range strings.Split(raw, ";") {
+		kv := strings.SplitN(pair, "=", 2)
+		value := ""
+		if len(kv) == 2 {
+			value = tagUnescaper.Replace(kv[1])
+		}
+		m.Tags[kv[0]] = value
+	}
+}
+
+// parsePrefix splits a raw source prefix (with the leading ":" already
+// stripped) into a Prefix's nick, user, and host segments.
+func parsePrefix(m *Message, raw string) {
+	bang, at := strings.IndexByte(raw, '!'), strings.IndexByte(raw, '@')
+	switch {
+	case bang >= 0 && at > bang:
+		m.Prefix.Nick = raw[:bang]
+		m.Prefix.User = raw[bang+1 : at]
+		m.Prefix.Host = raw[at+1:]
+	case at >= 0:
+		m.Prefix.Nick = raw[:at]
+		m.Prefix.Host = raw[at+1:]
+	default:
+		m.Prefix.Nick = raw
+	}
+}
+
+// String formats a Message back into a raw IRC protocol line, without a
+// trailing "\r\n".
+func (m *Message) String() string {
+	var b strings.Builder
+
+	if len(m.Tags) > 0 {
+		b.WriteByte('@')
+		first := true
+		for k, v := range m.Tags {
+			if !first {
+				b.WriteByte(';')
+			}
+			first = false
+			b.WriteString(k)
+			if len(v) > 0 {
+				b.WriteByte('=')
+				b.WriteString(tagEscaper.Replace(v))
+			}
+		}
+		b.WriteByte(' ')
+	}
+
+	if prefix := m.Prefix.String(); len(prefix) > 0 {
+		b.WriteByte(':')
+		b.WriteString(prefix)
+		b.WriteByte(' ')
+	}
+
+	b.WriteString(m.Command)
+	for i, param := range m.Params {
+		b.WriteByte(' ')
+		last := i == len(m.Params)-1
+		if last && (len(param) == 0 || strings.ContainsAny(param, " :")) {
+			b.WriteByte(':')
+		}
+		b.WriteString(param)
+	}
+
+	return b.String()
+}
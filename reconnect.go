@@ -0,0 +1,178 @@
+package ircutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Reconnect configures Run's automatic reconnection behavior.
+type Reconnect struct {
+	// (Optional) Whether Run automatically reconnects after the connection
+	// drops, instead of returning. Default: false
+	Enabled bool `json:"enabled"`
+	// (Optional) Delay before the first reconnection attempt, doubled after
+	// every subsequent attempt up to Max. Default: 2 seconds
+	Base time.Duration `json:"base"`
+	// (Optional) Maximum delay between reconnection attempts. Default: 5
+	// minutes
+	Max time.Duration `json:"max"`
+	// (Optional) Maximum number of consecutive reconnection attempts before
+	// Run gives up and returns an error, or 0 for unlimited. Default: 0
+	MaxAttempts int `json:"maxAttempts"`
+}
+
+// chatHistoryCaps are the IRCv3 capabilities indicating a server retains
+// message history and can replay it on request via CHATHISTORY.
+var chatHistoryCaps = []string{"draft/chathistory", "soju.im/bouncer-networks"}
+
+// Run supervises EstablishConnection, automatically reconnecting with
+// exponential backoff (per Client.Reconnect) whenever the connection drops.
+// Each reconnection re-issues JOIN for every channel known to the state
+// tracker, using its remembered key, and, if the server negotiated
+// draft/chathistory or soju.im/bouncer-networks, requests the messages
+// missed while disconnected via CHATHISTORY LATEST. Run blocks until ctx is
+// canceled, or until the connection drops with reconnection disabled or its
+// attempts exhausted, whichever happens first.
+func (client *Client) Run(ctx context.Context) error {
+	if client.Done == nil {
+		client.Done = make(chan bool)
+	}
+
+	var attemptMu sync.Mutex
+	attempt := 0
+	remove := client.HandleFunc("REGISTER", func(c *Client, m *Message) {
+		attemptMu.Lock()
+		attempt = 0
+		attemptMu.Unlock()
+	})
+	defer remove.Remove()
+
+	reconnecting := false
+	for {
+		if err := EstablishConnection(client); err != nil {
+			return err
+		}
+		if reconnecting {
+			resumeSession(client)
+			dispatch(client, "RECONNECTED", nil)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-client.Done:
+		}
+
+		attemptMu.Lock()
+		n := attempt
+		attemptMu.Unlock()
+
+		if !client.Reconnect.Enabled {
+			return errors.New("running client: disconnected and reconnection disabled")
+		}
+		if client.Reconnect.MaxAttempts > 0 && n >= client.Reconnect.MaxAttempts {
+			return fmt.Errorf("running client: exceeded %d reconnection attempts",
+				client.Reconnect.MaxAttempts)
+		}
+
+		dispatch(client, "RECONNECTING", nil)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoffDelay(client.Reconnect, n)):
+		}
+
+		attemptMu.Lock()
+		attempt++
+		attemptMu.Unlock()
+		reconnecting = true
+		client.Done = make(chan bool)
+	}
+}
+
+// backoffDelay computes the delay before reconnection attempt (0-indexed),
+// doubling cfg.Base every attempt up to cfg.Max and applying up to ±20%
+// jitter so multiple clients reconnecting to the same server do not stay in
+// lockstep.
+func backoffDelay(cfg Reconnect, attempt int) time.Duration {
+	base := cfg.Base
+	if base <= 0 {
+		base = 2 * time.Second
+	}
+	maxDelay := cfg.Max
+	if maxDelay <= 0 {
+		maxDelay = 5 * time.Minute
+	}
+
+	delay := base
+	for i := 0; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	delay += time.Duration((rand.Float64()*2 - 1) * 0.2 * float64(delay))
+	if delay < 0 {
+		delay = 0
+	}
+	return delay
+}
+
+// resumeSession re-joins every channel known to the state tracker, using its
+// remembered key, and requests missed history for each via CHATHISTORY if
+// the server negotiated a capability that supports it.
+func resumeSession(client *Client) {
+	s := client.State()
+	s.mu.RLock()
+	channels := make([]*Channel, 0, len(s.channels))
+	for _, ch := range s.channels {
+		channels = append(channels, ch)
+	}
+	s.mu.RUnlock()
+
+	replay := hasChatHistory(client)
+	for _, ch := range channels {
+		SendJoin(client, ch.Name, ch.Key)
+		if replay {
+			requestChatHistory(client, ch.Name)
+		}
+	}
+}
+
+// hasChatHistory reports whether the server negotiated a capability that
+// lets the client request messages missed while disconnected.
+func hasChatHistory(client *Client) bool {
+	for _, enabled := range client.EnabledCaps {
+		for _, c := range chatHistoryCaps {
+			if enabled == c {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requestChatHistory requests up to the 100 most recent messages missed in
+// target since the last one recorded by the state tracker, anchoring on its
+// msgid if known, falling back to its server-time tag, and to the server's
+// literal latest history otherwise.
+func requestChatHistory(client *Client, target string) {
+	msgid, t, ok := client.State().LastSeen(target)
+	if !ok {
+		return
+	}
+
+	criteria := "*"
+	switch {
+	case len(msgid) > 0:
+		criteria = "msgid=" + msgid
+	case len(t) > 0:
+		criteria = "timestamp=" + t
+	}
+	sendRawf(client, "CHATHISTORY LATEST %s %s 100", target, criteria)
+}
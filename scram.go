@@ -0,0 +1,166 @@
+package ircutil
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// scramState tracks the progress of a SCRAM-SHA-256 SASL exchange across the
+// three AUTHENTICATE round trips it requires.
+type scramState struct {
+	step            int
+	clientNonce     string
+	clientFirstBare string
+	serverSignature []byte
+}
+
+// handleSCRAMChallenge advances a SCRAM-SHA-256 exchange by one step. It is
+// called once per AUTHENTICATE challenge received from the server: the
+// first (empty) challenge sends the client-first-message, the second sends
+// the client-final-message, and the third verifies the server signature.
+func handleSCRAMChallenge(client *Client, data string) {
+	if client.scram == nil {
+		client.scram = &scramState{}
+	}
+	s := client.scram
+
+	switch s.step {
+	case 0:
+		nonce := make([]byte, 18)
+		rand.Read(nonce)
+		s.clientNonce = base64.StdEncoding.EncodeToString(nonce)
+		s.clientFirstBare = fmt.Sprintf("n=%s,r=%s",
+			client.Authentication.SASLUser, s.clientNonce)
+		s.step++
+		sendSASLPayload(client, []byte("n,,"+s.clientFirstBare))
+	case 1:
+		final, serverSig, err := scramClientFinal(client, s, data)
+		if err != nil {
+			client.scram = nil
+			failSASL(client, err)
+			return
+		}
+		s.serverSignature = serverSig
+		s.step++
+		sendSASLPayload(client, []byte(final))
+	case 2:
+		err := scramVerifyServer(s, data)
+		client.scram = nil
+		if err != nil {
+			failSASL(client, err)
+			return
+		}
+	}
+}
+
+// scramClientFinal parses the server-first-message and returns the
+// client-final-message along with the expected ServerSignature to verify
+// against the server-final-message.
+func scramClientFinal(client *Client, s *scramState, serverFirst string) (
+	string, []byte, error) {
+	fields := parseSCRAMFields(serverFirst)
+	nonce, salt, iterStr := fields["r"], fields["s"], fields["i"]
+	if len(nonce) < 1 || len(salt) < 1 || len(iterStr) < 1 {
+		return "", nil, fmt.Errorf(
+			"authenticating: malformed SCRAM server-first-message")
+	}
+	if !strings.HasPrefix(nonce, s.clientNonce) {
+		return "", nil, fmt.Errorf(
+			"authenticating: SCRAM server nonce does not extend client nonce")
+	}
+	iterations, err := strconv.Atoi(iterStr)
+	if err != nil {
+		return "", nil, fmt.Errorf("authenticating: invalid SCRAM iteration count")
+	}
+	saltedPassword, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		return "", nil, fmt.Errorf("authenticating: invalid SCRAM salt")
+	}
+
+	key := pbkdf2HMACSHA256([]byte(client.Authentication.SASLPass), saltedPassword,
+		iterations, sha256.Size)
+	clientKey := hmacSHA256(key, []byte("Client Key"))
+	storedKey := sha256.Sum256(clientKey)
+	channelBinding := base64.StdEncoding.EncodeToString([]byte("n,,"))
+	clientFinalWithoutProof := fmt.Sprintf("c=%s,r=%s", channelBinding, nonce)
+	authMessage := strings.Join([]string{s.clientFirstBare, serverFirst,
+		clientFinalWithoutProof}, ",")
+
+	clientSignature := hmacSHA256(storedKey[:], []byte(authMessage))
+	clientProof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		clientProof[i] = clientKey[i] ^ clientSignature[i]
+	}
+
+	serverKey := hmacSHA256(key, []byte("Server Key"))
+	serverSignature := hmacSHA256(serverKey, []byte(authMessage))
+
+	final := fmt.Sprintf("%s,p=%s", clientFinalWithoutProof,
+		base64.StdEncoding.EncodeToString(clientProof))
+	return final, serverSignature, nil
+}
+
+// scramVerifyServer confirms the server-final-message's signature matches
+// the one computed from the client-final exchange.
+func scramVerifyServer(s *scramState, serverFinal string) error {
+	fields := parseSCRAMFields(serverFinal)
+	if errMsg, ok := fields["e"]; ok {
+		return fmt.Errorf("authenticating: SCRAM error: %s", errMsg)
+	}
+	v, ok := fields["v"]
+	if !ok {
+		return fmt.Errorf("authenticating: malformed SCRAM server-final-message")
+	}
+	signature, err := base64.StdEncoding.DecodeString(v)
+	if err != nil || !hmac.Equal(signature, s.serverSignature) {
+		return fmt.Errorf("authenticating: SCRAM server signature mismatch")
+	}
+	return nil
+}
+
+// parseSCRAMFields splits a comma-separated "key=value" SCRAM attribute list
+// into a map.
+func parseSCRAMFields(msg string) map[string]string {
+	fields := make(map[string]string)
+	for _, part := range strings.Split(msg, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+	return fields
+}
+
+// hmacSHA256 computes an HMAC-SHA256 digest of data using key.
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// pbkdf2HMACSHA256 derives a key of keyLen bytes from password and salt
+// using PBKDF2 with HMAC-SHA256, as required by SCRAM-SHA-256.
+func pbkdf2HMACSHA256(password, salt []byte, iter, keyLen int) []byte {
+	var dk []byte
+	for block := 1; len(dk) < keyLen; block++ {
+		blockIndex := make([]byte, 4)
+		binary.BigEndian.PutUint32(blockIndex, uint32(block))
+
+		u := hmacSHA256(password, append(append([]byte{}, salt...), blockIndex...))
+		t := append([]byte{}, u...)
+		for i := 1; i < iter; i++ {
+			u = hmacSHA256(password, u)
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		dk = append(dk, t...)
+	}
+	return dk[:keyLen]
+}
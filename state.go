@@ -0,0 +1,525 @@
+package ircutil
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ChanUser stores a user's status within a specific channel, such as the
+// operator/voice mode prefixes currently applied to them.
+type ChanUser struct {
+	// Prefixes holds the mode prefix characters (e.g. "@", "+") currently
+	// applied to the user in the channel, in the order they were granted.
+	Prefixes string
+}
+
+// Channel stores known information about a channel the client is on.
+type Channel struct {
+	Name  string
+	Topic string
+	Key   string
+	Modes map[rune]string
+	Users map[string]*ChanUser
+}
+
+// StateUser stores known information about a user visible to the client,
+// either because they share a channel with the client or because the
+// client itself is that user.
+type StateUser struct {
+	Nick     string
+	User     string
+	Host     string
+	Account  string
+	Realname string
+	Channels map[string]*ChanUser
+}
+
+// historyMark records the most recent message seen for a target, so a
+// dropped connection can request exactly what was missed via CHATHISTORY.
+type historyMark struct {
+	msgid string
+	time  string
+}
+
+// State tracks the client's authoritative, goroutine-safe knowledge of the
+// channels it is on and the users visible in them, kept up to date by
+// handlers registered on the client. Retrieve it with Client.State.
+type State struct {
+	client *Client
+
+	mu       sync.RWMutex
+	channels map[string]*Channel
+	users    map[string]*StateUser
+	isupport map[string]string
+	history  map[string]historyMark
+}
+
+// State returns the client's channel and user state tracker, creating it on
+// first use.
+func (client *Client) State() *State {
+	if client.state == nil {
+		client.state = &State{
+			client:   client,
+			channels: make(map[string]*Channel),
+			users:    make(map[string]*StateUser),
+			isupport: make(map[string]string),
+			history:  make(map[string]historyMark),
+		}
+	}
+	return client.state
+}
+
+// Channel returns known state for the given channel name, or nil if the
+// client does not believe it is currently on that channel.
+func (s *State) Channel(name string) *Channel {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.channels[name]
+}
+
+// User returns known state for the given nickname, or nil if the client has
+// not seen that user.
+func (s *State) User(nick string) *StateUser {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.users[nick]
+}
+
+// Me returns state for the client's own nickname.
+func (s *State) Me() *StateUser {
+	return s.User(s.client.Nick)
+}
+
+// IsOn reports whether nick is known to be present in channel.
+func (s *State) IsOn(channel string, nick string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ch, ok := s.channels[channel]
+	if !ok {
+		return false
+	}
+	_, ok = ch.Users[nick]
+	return ok
+}
+
+// channelLocked returns the Channel for name, creating it if necessary. The
+// caller must hold s.mu.
+func (s *State) channelLocked(name string) *Channel {
+	ch, ok := s.channels[name]
+	if !ok {
+		ch = &Channel{
+			Name:  name,
+			Modes: make(map[rune]string),
+			Users: make(map[string]*ChanUser),
+		}
+		s.channels[name] = ch
+	}
+	return ch
+}
+
+// userLocked returns the StateUser for nick, creating it if necessary. The
+// caller must hold s.mu.
+func (s *State) userLocked(nick string) *StateUser {
+	u, ok := s.users[nick]
+	if !ok {
+		u = &StateUser{Nick: nick, Channels: make(map[string]*ChanUser)}
+		s.users[nick] = u
+	}
+	return u
+}
+
+// prefixTokens parses the ISUPPORT PREFIX token (e.g. "(ov)@+") into its
+// mode letters and their corresponding symbols, falling back to the common
+// "ov"/"@+" default if the server has not yet advertised one.
+func (s *State) prefixTokens() (modes string, symbols string) {
+	raw, ok := s.isupport["PREFIX"]
+	if !ok || len(raw) < 2 || raw[0] != '(' {
+		return "ov", "@+"
+	}
+	end := strings.IndexByte(raw, ')')
+	if end < 0 {
+		return "ov", "@+"
+	}
+	return raw[1:end], raw[end+1:]
+}
+
+// ServerOption returns the raw value of an ISUPPORT (005) token advertised
+// by the server, and whether it was present at all.
+func (client *Client) ServerOption(key string) (string, bool) {
+	s := client.State()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.isupport[key]
+	return value, ok
+}
+
+// ServerOptionInt returns the integer value of an ISUPPORT (005) token
+// advertised by the server, and whether it was present with a valid integer
+// value.
+func (client *Client) ServerOptionInt(key string) (int, bool) {
+	value, ok := client.ServerOption(key)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	return n, err == nil
+}
+
+// LastSeen returns the msgid and server-time tag of the most recent message
+// recorded for target, and whether any has been seen, so a reconnection can
+// resume a draft/chathistory or soju.im/bouncer-networks session from that
+// point.
+func (s *State) LastSeen(target string) (msgid string, time string, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	mark, ok := s.history[target]
+	return mark.msgid, mark.time, ok
+}
+
+// removeFromChannel removes nick from channel's user list, dropping the
+// channel entirely if nick is the client's own nickname, and forgetting the
+// user altogether once they share no more known channels with the client.
+func removeFromChannel(s *State, channel string, nick string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ch, ok := s.channels[channel]; ok {
+		delete(ch.Users, nick)
+		if nick == s.client.Nick {
+			delete(s.channels, channel)
+		}
+	}
+	if u, ok := s.users[nick]; ok {
+		delete(u.Channels, channel)
+		if len(u.Channels) < 1 && nick != s.client.Nick {
+			delete(s.users, nick)
+		}
+	}
+}
+
+// registerStateHandlers installs the handlers that keep a client's State up
+// to date as channel and user related messages arrive.
+func registerStateHandlers(client *Client) {
+	client.State()
+
+	client.HandleFunc("5", handleStateISupport)
+	client.HandleFunc("JOIN", handleStateJoin)
+	client.HandleFunc("PART", handleStatePart)
+	client.HandleFunc("QUIT", handleStateQuit)
+	client.HandleFunc("KICK", handleStateKick)
+	client.HandleFunc("NICK", handleStateNick)
+	client.HandleFunc("MODE", handleStateMode)
+	client.HandleFunc("TOPIC", handleStateTopic)
+	client.HandleFunc("332", handleStateTopicReply)
+	client.HandleFunc("353", handleStateNames)
+	client.HandleFunc("324", handleStateChannelModeIs)
+	client.HandleFunc("PRIVMSG", handleStateHistory)
+	client.HandleFunc("NOTICE", handleStateHistory)
+}
+
+// handleStateISupport records RPL_ISUPPORT (005) tokens, ignoring the
+// trailing human-readable "are supported by this server" parameter.
+func handleStateISupport(client *Client, msg *Message) {
+	if len(msg.Params) < 2 {
+		return
+	}
+	s := client.State()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, token := range msg.Params[1 : len(msg.Params)-1] {
+		token = strings.TrimPrefix(token, "-")
+		kv := strings.SplitN(token, "=", 2)
+		if len(kv) == 2 {
+			s.isupport[kv[0]] = kv[1]
+		} else {
+			s.isupport[kv[0]] = ""
+		}
+	}
+}
+
+// handleStateJoin records a user joining a channel, including the account
+// and realname carried by the extended-join capability when present.
+func handleStateJoin(client *Client, msg *Message) {
+	if len(msg.Params) < 1 || len(msg.Prefix.Nick) < 1 {
+		return
+	}
+	channel := msg.Params[0]
+	s := client.State()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := s.channelLocked(channel)
+	u := s.userLocked(msg.Prefix.Nick)
+	u.User = msg.Prefix.User
+	u.Host = msg.Prefix.Host
+	if len(msg.Params) > 1 {
+		u.Account = msg.Params[1]
+	}
+	if len(msg.Params) > 2 {
+		u.Realname = msg.Params[2]
+	}
+
+	cu := &ChanUser{}
+	ch.Users[msg.Prefix.Nick] = cu
+	u.Channels[channel] = cu
+}
+
+// handleStatePart records a user leaving a channel.
+func handleStatePart(client *Client, msg *Message) {
+	if len(msg.Params) < 1 {
+		return
+	}
+	removeFromChannel(client.State(), msg.Params[0], msg.Prefix.Nick)
+}
+
+// handleStateKick records a user being removed from a channel by force.
+func handleStateKick(client *Client, msg *Message) {
+	if len(msg.Params) < 2 {
+		return
+	}
+	removeFromChannel(client.State(), msg.Params[0], msg.Params[1])
+}
+
+// handleStateQuit forgets a user entirely, removing them from every channel
+// the client believed they shared.
+func handleStateQuit(client *Client, msg *Message) {
+	nick := msg.Prefix.Nick
+	if len(nick) < 1 {
+		return
+	}
+	s := client.State()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[nick]; ok {
+		for channel := range u.Channels {
+			if ch, ok := s.channels[channel]; ok {
+				delete(ch.Users, nick)
+			}
+		}
+	}
+	delete(s.users, nick)
+}
+
+// handleStateNick renames a tracked user across the user and channel maps.
+func handleStateNick(client *Client, msg *Message) {
+	if len(msg.Params) < 1 || len(msg.Prefix.Nick) < 1 {
+		return
+	}
+	oldNick, newNick := msg.Prefix.Nick, msg.Params[0]
+	s := client.State()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[oldNick]
+	if !ok {
+		return
+	}
+	delete(s.users, oldNick)
+	u.Nick = newNick
+	s.users[newNick] = u
+
+	for channel := range u.Channels {
+		ch, ok := s.channels[channel]
+		if !ok {
+			continue
+		}
+		cu := ch.Users[oldNick]
+		delete(ch.Users, oldNick)
+		ch.Users[newNick] = cu
+	}
+}
+
+// handleStateTopic records a channel's topic as changed by a TOPIC command.
+func handleStateTopic(client *Client, msg *Message) {
+	if len(msg.Params) < 2 {
+		return
+	}
+	s := client.State()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channelLocked(msg.Params[0]).Topic = msg.Params[1]
+}
+
+// handleStateTopicReply records a channel's current topic from RPL_TOPIC
+// (332), sent in response to joining a channel or querying its topic.
+func handleStateTopicReply(client *Client, msg *Message) {
+	if len(msg.Params) < 3 {
+		return
+	}
+	s := client.State()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channelLocked(msg.Params[1]).Topic = msg.Params[2]
+}
+
+// handleStateNames records the users present in a channel from RPL_NAMREPLY
+// (353), splitting each name's leading mode prefix symbols.
+func handleStateNames(client *Client, msg *Message) {
+	if len(msg.Params) < 4 {
+		return
+	}
+	channel := msg.Params[2]
+	s := client.State()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, symbols := s.prefixTokens()
+	ch := s.channelLocked(channel)
+	for _, name := range strings.Fields(msg.Params[3]) {
+		prefixes := ""
+		for len(name) > 0 && strings.ContainsRune(symbols, rune(name[0])) {
+			prefixes += string(name[0])
+			name = name[1:]
+		}
+
+		cu, ok := ch.Users[name]
+		if !ok {
+			cu = &ChanUser{}
+			ch.Users[name] = cu
+		}
+		cu.Prefixes = prefixes
+
+		u := s.userLocked(name)
+		u.Channels[channel] = cu
+	}
+}
+
+// handleStateHistory records the msgid and server-time tags of the most
+// recent PRIVMSG/NOTICE seen for a target, letting a later reconnection
+// request exactly what was missed via CHATHISTORY.
+func handleStateHistory(client *Client, msg *Message) {
+	if len(msg.Params) < 1 {
+		return
+	}
+	msgid, hasMsgid := msg.Tags["msgid"]
+	t, hasTime := msg.Tags["time"]
+	if !hasMsgid && !hasTime {
+		return
+	}
+
+	s := client.State()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history[msg.Params[0]] = historyMark{msgid: msgid, time: t}
+}
+
+// handleStateChannelModeIs replaces a channel's known modes from
+// RPL_CHANNELMODEIS (324), sent in response to a bare MODE query.
+func handleStateChannelModeIs(client *Client, msg *Message) {
+	if len(msg.Params) < 3 {
+		return
+	}
+	s := client.State()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := s.channelLocked(msg.Params[1])
+	ch.Modes = make(map[rune]string)
+	applyModeStringLocked(s, ch, msg.Params[2], msg.Params[3:])
+}
+
+// handleStateMode applies a channel MODE change to state, ignoring mode
+// changes targeting a user rather than a channel.
+func handleStateMode(client *Client, msg *Message) {
+	if len(msg.Params) < 2 || !IsChannel(msg.Params[0]) {
+		return
+	}
+	s := client.State()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := s.channelLocked(msg.Params[0])
+	applyModeStringLocked(s, ch, msg.Params[1], msg.Params[2:])
+}
+
+// applyModeStringLocked applies a mode change string (e.g. "+ov-k") to ch,
+// consuming arguments for modes that require one as determined by the
+// ISUPPORT PREFIX and CHANMODES tokens. The caller must hold s.mu.
+func applyModeStringLocked(s *State, ch *Channel, modeStr string, args []string) {
+	prefixModes, _ := s.prefixTokens()
+	parts := strings.SplitN(s.isupport["CHANMODES"], ",", 4)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	typeA, typeB, typeC := parts[0], parts[1], parts[2]
+
+	adding, argIdx := true, 0
+	nextArg := func() string {
+		if argIdx >= len(args) {
+			return ""
+		}
+		arg := args[argIdx]
+		argIdx++
+		return arg
+	}
+
+	for _, r := range modeStr {
+		switch {
+		case r == '+':
+			adding = true
+		case r == '-':
+			adding = false
+		case strings.ContainsRune(prefixModes, r):
+			applyPrefixModeLocked(s, ch, r, nextArg(), adding)
+		case strings.ContainsRune(typeA, r), strings.ContainsRune(typeB, r):
+			arg := nextArg()
+			if adding {
+				ch.Modes[r] = arg
+				if r == 'k' {
+					ch.Key = arg
+				}
+			} else {
+				delete(ch.Modes, r)
+				if r == 'k' {
+					ch.Key = ""
+				}
+			}
+		case strings.ContainsRune(typeC, r):
+			if adding {
+				ch.Modes[r] = nextArg()
+			} else {
+				delete(ch.Modes, r)
+			}
+		default:
+			if adding {
+				ch.Modes[r] = ""
+			} else {
+				delete(ch.Modes, r)
+			}
+		}
+	}
+}
+
+// applyPrefixModeLocked grants or revokes a PREFIX mode (e.g. "o"/"@") to a
+// channel member. The caller must hold s.mu.
+func applyPrefixModeLocked(s *State, ch *Channel, mode rune, nick string,
+	adding bool) {
+	cu, ok := ch.Users[nick]
+	if !ok {
+		cu = &ChanUser{}
+		ch.Users[nick] = cu
+	}
+
+	modes, symbols := s.prefixTokens()
+	idx := strings.IndexRune(modes, mode)
+	if idx < 0 || idx >= len(symbols) {
+		return
+	}
+	symbol := rune(symbols[idx])
+
+	if adding {
+		if !strings.ContainsRune(cu.Prefixes, symbol) {
+			cu.Prefixes += string(symbol)
+		}
+		return
+	}
+	cu.Prefixes = strings.Map(func(c rune) rune {
+		if c == symbol {
+			return -1
+		}
+		return c
+	}, cu.Prefixes)
+}
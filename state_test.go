@@ -0,0 +1,33 @@
+package ircutil
+
+import (
+	"testing"
+	"time"
+)
+
+// TestServerOptionFromISupport drives a raw 005 (RPL_ISUPPORT) line through
+// parseMessage and asserts ServerOption surfaces the advertised tokens,
+// guarding against handleResponse's normalized numeric dispatch ("5") and
+// registerStateHandlers' registration getting out of sync again.
+func TestServerOptionFromISupport(t *testing.T) {
+	client := &Client{}
+	registerStateHandlers(client)
+
+	parseMessage(client, "005 Inami PREFIX=(ov)@+ CHANMODES=b,k,l,imnpst "+
+		":are supported by this server\r\n")
+
+	deadline := time.After(time.Second)
+	for {
+		if v, ok := client.ServerOption("PREFIX"); ok {
+			if v != "(ov)@+" {
+				t.Errorf("ServerOption(\"PREFIX\") = %q, expected \"(ov)@+\"", v)
+			}
+			return
+		}
+		select {
+		case <-deadline:
+			t.Fatal("ServerOption(\"PREFIX\") was never set after a 005 line")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package ircutil
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Transport establishes the underlying connection used by
+// EstablishConnection, allowing ircutil to connect through mediums other
+// than a raw TCP/TLS socket (e.g. a WebSocket gateway). Set Client.Transport
+// to override the default.
+type Transport interface {
+	Dial(ctx context.Context, host string, port uint16, secure bool) (net.Conn, error)
+}
+
+// tcpTransport is the default Transport, dialing a raw TCP or TLS socket.
+type tcpTransport struct {
+	tlsConfig *tls.Config
+}
+
+// Dial opens a TCP connection to host:port, upgrading to TLS when secure is
+// true.
+func (t tcpTransport) Dial(ctx context.Context, host string, port uint16,
+	secure bool) (net.Conn, error) {
+	addr := fmt.Sprintf("%s:%d", host, port)
+	dialer := &net.Dialer{}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+
+	if !secure {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+	tlsConfig := t.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	return tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+}
+
+// dial resolves client.Transport (configuring the default TCP/TLS transport,
+// including a SASL EXTERNAL client certificate if one was set, when unset)
+// and uses it to establish the underlying connection.
+func dial(client *Client) (net.Conn, error) {
+	if client.Transport == nil {
+		tlsConfig := &tls.Config{}
+		if len(client.Authentication.SASLCertFile) > 0 {
+			cert, err := tls.LoadX509KeyPair(client.Authentication.SASLCertFile,
+				client.Authentication.SASLKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		client.Transport = tcpTransport{tlsConfig: tlsConfig}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	return client.Transport.Dial(ctx, client.Server.Host, client.Server.Port,
+		client.Server.Secure)
+}
@@ -0,0 +1,308 @@
+package ircutil
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// websocketGUID is appended to the handshake's Sec-WebSocket-Key before
+// hashing to derive the expected Sec-WebSocket-Accept value, as fixed by
+// RFC 6455.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WEBIRCHandshake carries the parameters of a WEBIRC command, sent
+// immediately after connecting so a trusted gateway can forward a client's
+// real hostname and IP to the server.
+type WEBIRCHandshake struct {
+	Password string
+	Gateway  string
+	Hostname string
+	IP       string
+}
+
+// WebSocketTransport dials an IRC server fronted by a WebSocket gateway
+// (e.g. kiwiirc's webircgateway), framing each "\r\n"-terminated protocol
+// line as a single WebSocket message.
+type WebSocketTransport struct {
+	// (Optional) HTTP path of the WebSocket endpoint. Default: "/webirc"
+	Path string
+	// (Optional) Origin header sent during the handshake. Default: ""
+	Origin string
+	// (Optional) Sec-WebSocket-Protocol sent during the handshake, commonly
+	// "text.ircv3.net" or "binary.ircv3.net". Default: "text.ircv3.net"
+	Subprotocol string
+	// (Optional) Whether IRC lines are framed as binary WebSocket messages
+	// instead of text ones. Default: false
+	Binary bool
+	// (Optional) WEBIRC handshake sent immediately after connecting, before
+	// PASS/NICK/USER. Default: nil (no handshake sent)
+	WEBIRC *WEBIRCHandshake
+}
+
+// Dial opens a WebSocket connection to host:port, performs the WebSocket
+// and (if configured) WEBIRC handshakes, and returns a net.Conn that frames
+// writes as single WebSocket messages and reassembles reads into a
+// continuous byte stream.
+func (t WebSocketTransport) Dial(ctx context.Context, host string, port uint16,
+	secure bool) (net.Conn, error) {
+	addr := fmt.Sprintf("%s:%d", host, port)
+	dialer := &net.Dialer{}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+
+	var conn net.Conn
+	var err error
+	if secure {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	path := t.Path
+	if len(path) < 1 {
+		path = "/webirc"
+	}
+	subprotocol := t.Subprotocol
+	if len(subprotocol) < 1 {
+		subprotocol = "text.ircv3.net"
+	}
+
+	reader := bufio.NewReader(conn)
+	if err := webSocketHandshake(conn, reader, host, path, t.Origin,
+		subprotocol); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ws := &webSocketConn{Conn: conn, reader: reader, binary: t.Binary}
+
+	if t.WEBIRC != nil {
+		if _, err := fmt.Fprintf(ws, "WEBIRC %s %s %s %s\r\n", t.WEBIRC.Password,
+			t.WEBIRC.Gateway, t.WEBIRC.Hostname, t.WEBIRC.IP); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return ws, nil
+}
+
+// webSocketHandshake performs the HTTP Upgrade exchange that establishes a
+// WebSocket connection over conn, reading the response through reader so
+// any bytes buffered ahead of the HTTP headers are preserved for later
+// frame reads.
+func webSocketHandshake(conn net.Conn, reader *bufio.Reader, host string,
+	path string, origin string, subprotocol string) error {
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+
+	var req strings.Builder
+	fmt.Fprintf(&req, "GET %s HTTP/1.1\r\n", path)
+	fmt.Fprintf(&req, "Host: %s\r\n", host)
+	req.WriteString("Upgrade: websocket\r\n")
+	req.WriteString("Connection: Upgrade\r\n")
+	fmt.Fprintf(&req, "Sec-WebSocket-Key: %s\r\n", key)
+	req.WriteString("Sec-WebSocket-Version: 13\r\n")
+	if len(origin) > 0 {
+		fmt.Fprintf(&req, "Origin: %s\r\n", origin)
+	}
+	if len(subprotocol) > 0 {
+		fmt.Fprintf(&req, "Sec-WebSocket-Protocol: %s\r\n", subprotocol)
+	}
+	req.WriteString("\r\n")
+
+	if _, err := conn.Write([]byte(req.String())); err != nil {
+		return err
+	}
+
+	resp, err := http.ReadResponse(reader, &http.Request{Method: "GET"})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("dialing websocket transport: unexpected status %q",
+			resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != webSocketAcceptKey(key) {
+		return errors.New(
+			"dialing websocket transport: invalid Sec-WebSocket-Accept")
+	}
+
+	return nil
+}
+
+// webSocketAcceptKey derives the expected Sec-WebSocket-Accept value for a
+// given Sec-WebSocket-Key, per RFC 6455.
+func webSocketAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// webSocketConn adapts a WebSocket connection to the net.Conn interface
+// expected by EstablishConnection, framing each write as a single WebSocket
+// message and reassembling inbound frames into a continuous byte stream for
+// Read, buffering partial messages between Read calls.
+type webSocketConn struct {
+	net.Conn
+	reader *bufio.Reader
+	binary bool
+
+	pending []byte
+}
+
+// Write sends p as a single masked WebSocket text (or, if Binary was set,
+// binary) message.
+func (c *webSocketConn) Write(p []byte) (int, error) {
+	opcode := byte(0x1)
+	if c.binary {
+		opcode = 0x2
+	}
+	if err := writeWebSocketFrame(c.Conn, opcode, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Read fills p from the current inbound message, reading and reassembling
+// further WebSocket frames as needed. The text.ircv3.net subprotocol SHOULD
+// omit the trailing "\r\n" from each message, so one is appended here when
+// missing to give readLoop's bufio.Reader.ReadString('\n') the line stream
+// it expects.
+func (c *webSocketConn) Read(p []byte) (int, error) {
+	for len(c.pending) < 1 {
+		payload, err := c.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		if !bytes.HasSuffix(payload, []byte("\n")) {
+			payload = append(payload, '\r', '\n')
+		}
+		c.pending = payload
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// readMessage reads one complete WebSocket message, reassembling
+// continuation frames and transparently answering pings.
+func (c *webSocketConn) readMessage() ([]byte, error) {
+	var message []byte
+	for {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(c.reader, header); err != nil {
+			return nil, err
+		}
+		fin := header[0]&0x80 != 0
+		opcode := header[0] & 0x0F
+		masked := header[1]&0x80 != 0
+		length := int64(header[1] & 0x7F)
+
+		switch length {
+		case 126:
+			ext := make([]byte, 2)
+			if _, err := io.ReadFull(c.reader, ext); err != nil {
+				return nil, err
+			}
+			length = int64(binary.BigEndian.Uint16(ext))
+		case 127:
+			ext := make([]byte, 8)
+			if _, err := io.ReadFull(c.reader, ext); err != nil {
+				return nil, err
+			}
+			length = int64(binary.BigEndian.Uint64(ext))
+		}
+
+		var mask []byte
+		if masked {
+			mask = make([]byte, 4)
+			if _, err := io.ReadFull(c.reader, mask); err != nil {
+				return nil, err
+			}
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.reader, payload); err != nil {
+			return nil, err
+		}
+		if masked {
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+		}
+
+		switch opcode {
+		case 0x8: // close
+			return nil, io.EOF
+		case 0x9: // ping: answer with a pong carrying the same payload
+			if err := writeWebSocketFrame(c.Conn, 0xA, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case 0xA: // pong
+			continue
+		}
+
+		message = append(message, payload...)
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// writeWebSocketFrame writes a single, masked WebSocket frame (as required
+// of a client) carrying opcode and payload to w.
+func writeWebSocketFrame(w io.Writer, opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+
+	length := len(payload)
+	switch {
+	case length <= 125:
+		header = append(header, 0x80|byte(length))
+	case length <= 65535:
+		header = append(header, 0x80|126, byte(length>>8), byte(length))
+	default:
+		ext := make([]byte, 8)
+		binary.BigEndian.PutUint64(ext, uint64(length))
+		header = append(header, 0x80|127)
+		header = append(header, ext...)
+	}
+
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	header = append(header, mask...)
+
+	masked := make([]byte, length)
+	for i, b := range payload {
+		masked[i] = b ^ mask[i%4]
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(masked)
+	return err
+}